@@ -0,0 +1,173 @@
+// Package credentialplugin provides the get-token subcommand, which runs
+// kubelogin as a client-go credential plugin.
+package credentialplugin
+
+import (
+	"context"
+	"encoding/base64"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/int128/kubelogin/pkg/adaptors/certpool"
+	"github.com/int128/kubelogin/pkg/adaptors/concierge"
+	"github.com/int128/kubelogin/pkg/adaptors/credentialpluginwriter"
+	"github.com/int128/kubelogin/pkg/adaptors/logger"
+	"github.com/int128/kubelogin/pkg/adaptors/tokencache"
+	"github.com/int128/kubelogin/pkg/usecases/authentication"
+	"github.com/int128/kubelogin/pkg/usecases/authentication/authcode"
+	"github.com/int128/kubelogin/pkg/usecases/authentication/ropc"
+	"github.com/int128/kubelogin/pkg/usecases/credentialplugin"
+)
+
+// Option holds the flags of the get-token subcommand.
+type Option struct {
+	IssuerURL      string
+	ClientID       string
+	ClientSecret   string
+	ExtraScopes    []string
+	CACertFilename string
+	CACertData     string
+	SkipTLSVerify  bool
+	TokenCacheDir  string
+
+	BindAddress     []string
+	SkipOpenBrowser bool
+	Username        string
+	Password        string
+
+	// IDPHintName and IDPHintParam back --oidc-idp-hint and
+	// --oidc-idp-hint-param: they select a named upstream identity provider
+	// federated behind the issuer and the query parameter used to carry it,
+	// e.g. "kc_idp_hint" for Keycloak, "idp" for Dex, or "acr_values".
+	IDPHintName  string
+	IDPHintParam string
+
+	// Concierge* back the --concierge-* flags: when ConciergeEnabled, the ID
+	// token is exchanged for a Pinniped concierge client certificate instead
+	// of being handed to client-go directly.
+	ConciergeEnabled           bool
+	ConciergeEndpoint          string
+	ConciergeCABundleData      string
+	ConciergeAPIGroupSuffix    string
+	ConciergeAuthenticatorKind string
+	ConciergeAuthenticatorName string
+
+	// Serve and ListenSocket back --serve and --listen-socket: when Serve is
+	// set, this runs as a background daemon on the Unix domain socket at
+	// ListenSocket instead of getting a single token and exiting.
+	Serve        bool
+	ListenSocket string
+
+	Verbosity int
+}
+
+// New returns the get-token subcommand.
+func New() *cobra.Command {
+	var o Option
+	cmd := &cobra.Command{
+		Use:   "get-token",
+		Short: "Run as a kubectl credential plugin",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(cmd.Context())
+		},
+	}
+	f := cmd.Flags()
+	f.StringVar(&o.IssuerURL, "oidc-issuer-url", "", "Issuer URL of the OpenID Connect provider")
+	f.StringVar(&o.ClientID, "oidc-client-id", "", "Client ID of the OpenID Connect provider")
+	f.StringVar(&o.ClientSecret, "oidc-client-secret", "", "Client secret of the OpenID Connect provider")
+	f.StringSliceVar(&o.ExtraScopes, "oidc-extra-scope", nil, "Scopes to request in addition to openid")
+	f.StringVar(&o.CACertFilename, "certificate-authority", "", "Path to a CA certificate file")
+	f.StringVar(&o.CACertData, "certificate-authority-data", "", "Base64 encoded CA certificate")
+	f.BoolVar(&o.SkipTLSVerify, "insecure-skip-tls-verify", false, "Disable TLS verification")
+	f.StringVar(&o.TokenCacheDir, "token-cache-dir", "", "Directory to cache tokens")
+	f.StringSliceVar(&o.BindAddress, "listen-address", []string{"127.0.0.1:8000", "127.0.0.1:18000"}, "Addresses to bind for the authorization code flow callback")
+	f.BoolVar(&o.SkipOpenBrowser, "skip-open-browser", false, "Do not open the browser automatically")
+	f.StringVar(&o.Username, "username", "", "Username for the resource owner password credentials grant")
+	f.StringVar(&o.Password, "password", "", "Password for the resource owner password credentials grant")
+	f.StringVar(&o.IDPHintName, "oidc-idp-hint", "", "Name of the upstream identity provider to select at the issuer")
+	f.StringVar(&o.IDPHintParam, "oidc-idp-hint-param", "", `Query parameter used to carry --oidc-idp-hint on the authorization URL (e.g. "kc_idp_hint", "idp", "acr_values"); defaults to "acr_values"`)
+	f.BoolVar(&o.ConciergeEnabled, "concierge-enabled", false, "Exchange the ID token for a Pinniped concierge client certificate")
+	f.StringVar(&o.ConciergeEndpoint, "concierge-endpoint", "", "URL of the Pinniped concierge's TokenCredentialRequest API")
+	f.StringVar(&o.ConciergeCABundleData, "concierge-ca-bundle-data", "", "Base64 encoded CA certificate of the concierge endpoint")
+	f.StringVar(&o.ConciergeAPIGroupSuffix, "concierge-api-group-suffix", "", `API group suffix of the concierge API; defaults to "pinniped.dev"`)
+	f.StringVar(&o.ConciergeAuthenticatorKind, "concierge-authenticator-type", "", `Kind of the concierge authenticator, e.g. "WebhookAuthenticator" or "JWTAuthenticator"`)
+	f.StringVar(&o.ConciergeAuthenticatorName, "concierge-authenticator-name", "", "Name of the concierge authenticator")
+	f.BoolVar(&o.Serve, "serve", false, "Run as a background daemon that keeps the token refreshed, instead of exiting after one token")
+	f.StringVar(&o.ListenSocket, "listen-socket", "", "Path of the Unix domain socket to serve on; required with --serve")
+	f.IntVar(&o.Verbosity, "v", 0, "Log verbosity")
+	return cmd
+}
+
+func (o *Option) run(ctx context.Context) error {
+	log := logger.New(o.Verbosity)
+	u := &credentialplugin.GetToken{
+		Authentication: &authentication.Authentication{
+			AuthCodeFlow: &authcode.Flow{},
+			ROPCFlow:     &ropc.Flow{},
+			Logger:       log,
+		},
+		TokenCacheRepository: &tokencache.Repository{},
+		NewCertPool:          certpool.New,
+		Concierge:            &concierge.Client{},
+		Writer:               &credentialpluginwriter.Writer{},
+		Logger:               log,
+	}
+	conciergeCABundle, err := o.conciergeCABundle()
+	if err != nil {
+		return xerrors.Errorf("could not decode --concierge-ca-bundle-data: %w", err)
+	}
+	in := credentialplugin.Input{
+		IssuerURL:      o.IssuerURL,
+		ClientID:       o.ClientID,
+		ClientSecret:   o.ClientSecret,
+		ExtraScopes:    o.ExtraScopes,
+		CACertFilename: o.CACertFilename,
+		CACertData:     o.CACertData,
+		SkipTLSVerify:  o.SkipTLSVerify,
+		TokenCacheDir:  o.TokenCacheDir,
+		GrantOptionSet: o.grantOptionSet(),
+
+		IdentityProviderName: o.IDPHintName,
+		IdentityProviderType: o.IDPHintParam,
+
+		ConciergeEnabled:        o.ConciergeEnabled,
+		ConciergeEndpoint:       o.ConciergeEndpoint,
+		ConciergeCABundle:       conciergeCABundle,
+		ConciergeAPIGroupSuffix: o.ConciergeAPIGroupSuffix,
+		ConciergeAuthenticator: corev1.TypedLocalObjectReference{
+			Kind: o.ConciergeAuthenticatorKind,
+			Name: o.ConciergeAuthenticatorName,
+		},
+	}
+	if o.Serve {
+		if o.ListenSocket == "" {
+			return xerrors.New("--listen-socket is required with --serve")
+		}
+		return u.Serve(ctx, in, o.ListenSocket)
+	}
+	return u.Do(ctx, in)
+}
+
+func (o *Option) conciergeCABundle() ([]byte, error) {
+	if o.ConciergeCABundleData == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(o.ConciergeCABundleData)
+}
+
+func (o *Option) grantOptionSet() authentication.GrantOptionSet {
+	if o.Username != "" {
+		return authentication.GrantOptionSet{
+			ROPCOption: &authentication.ROPCOption{Username: o.Username, Password: o.Password},
+		}
+	}
+	return authentication.GrantOptionSet{
+		AuthCodeOption: &authentication.AuthCodeOption{
+			BindAddress:     o.BindAddress,
+			SkipOpenBrowser: o.SkipOpenBrowser,
+		},
+	}
+}
@@ -0,0 +1,61 @@
+// Package certpool provides the adaptor for building a x509 certificate pool
+// from the system trust store plus any user-supplied CA certificates.
+package certpool
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// NewFunc creates a new Interface backed by the system trust store.
+type NewFunc func() Interface
+
+// New returns a new Interface backed by the system trust store.
+func New() Interface {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	return &CertPool{pool: pool}
+}
+
+// Interface adds certificates to the pool.
+type Interface interface {
+	AddFile(filename string) error
+	AddBase64Encoded(base64Data string) error
+	Pool() *x509.CertPool
+}
+
+// CertPool wraps a x509.CertPool.
+type CertPool struct {
+	pool *x509.CertPool
+}
+
+func (c *CertPool) Pool() *x509.CertPool {
+	return c.pool
+}
+
+func (c *CertPool) AddFile(filename string) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return xerrors.Errorf("could not read the certificate file: %w", err)
+	}
+	if !c.pool.AppendCertsFromPEM(b) {
+		return xerrors.Errorf("could not append the certificate in %s", filename)
+	}
+	return nil
+}
+
+func (c *CertPool) AddBase64Encoded(base64Data string) error {
+	b, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return xerrors.Errorf("could not decode the base64 string: %w", err)
+	}
+	if !c.pool.AppendCertsFromPEM(b) {
+		return xerrors.Errorf("could not append the certificate")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package concierge provides the adaptor for exchanging an OIDC ID token for a
+// short-lived mTLS client certificate via the Pinniped concierge's aggregated
+// TokenCredentialRequest API.
+//
+// See https://github.com/vmware-tanzu/pinniped for the upstream protocol.
+package concierge
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"golang.org/x/xerrors"
+)
+
+// Input represents an input DTO of the Exchange call.
+type Input struct {
+	Endpoint       string
+	CABundle       []byte
+	APIGroupSuffix string // defaults to "pinniped.dev" upstream, overridable for custom installs
+	Authenticator  corev1.TypedLocalObjectReference
+	IDToken        string
+}
+
+// Output represents the mTLS client credential returned by the concierge.
+type Output struct {
+	ClientCertificateData string
+	ClientKeyData         string
+	ExpirationTimestamp   metav1.Time
+}
+
+// Interface exchanges an OIDC ID token for a client certificate.
+type Interface interface {
+	Exchange(ctx context.Context, in Input) (*Output, error)
+}
+
+// Client implements Interface by calling the concierge's TokenCredentialRequest API.
+type Client struct{}
+
+func (*Client) Exchange(ctx context.Context, in Input) (*Output, error) {
+	httpClient, err := newHTTPClient(in.CABundle)
+	if err != nil {
+		return nil, xerrors.Errorf("could not set up the HTTP client for the concierge: %w", err)
+	}
+
+	group := in.APIGroupSuffix
+	if group == "" {
+		group = "pinniped.dev"
+	}
+	reqBody := tokenCredentialRequest{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "login.concierge." + group + "/v1alpha1",
+			Kind:       "TokenCredentialRequest",
+		},
+		Spec: tokenCredentialRequestSpec{
+			Token:         in.IDToken,
+			Authenticator: in.Authenticator,
+		},
+	}
+	b, err := json.Marshal(&reqBody)
+	if err != nil {
+		return nil, xerrors.Errorf("could not marshal the TokenCredentialRequest: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, xerrors.Errorf("could not create the request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("could not send the TokenCredentialRequest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("could not read the TokenCredentialRequest response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, xerrors.Errorf("concierge returned %s: %s", resp.Status, body)
+	}
+
+	var respBody tokenCredentialRequest
+	if err := json.Unmarshal(body, &respBody); err != nil {
+		return nil, xerrors.Errorf("could not decode the TokenCredentialRequest response: %w", err)
+	}
+	if respBody.Status.Message != "" {
+		return nil, xerrors.Errorf("concierge rejected the credential request: %s", respBody.Status.Message)
+	}
+	if respBody.Status.Credential == nil {
+		return nil, xerrors.New("concierge did not return a credential")
+	}
+	return &Output{
+		ClientCertificateData: respBody.Status.Credential.ClientCertificateData,
+		ClientKeyData:         respBody.Status.Credential.ClientKeyData,
+		ExpirationTimestamp:   respBody.Status.Credential.ExpirationTimestamp,
+	}, nil
+}
+
+func newHTTPClient(caBundle []byte) (*http.Client, error) {
+	if len(caBundle) == 0 {
+		return http.DefaultClient, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, xerrors.New("could not parse the concierge CA bundle")
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
@@ -0,0 +1,71 @@
+package concierge_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/int128/kubelogin/pkg/adaptors/concierge"
+)
+
+func TestClient_Exchange(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{
+				"status": {
+					"credential": {
+						"clientCertificateData": "cert",
+						"clientKeyData": "key",
+						"expirationTimestamp": "2030-01-01T00:00:00Z"
+					}
+				}
+			}`))
+		}))
+		defer srv.Close()
+
+		c := &concierge.Client{}
+		out, err := c.Exchange(context.Background(), concierge.Input{Endpoint: srv.URL, IDToken: "id-token"})
+		if err != nil {
+			t.Fatalf("Exchange() returned an error: %s", err)
+		}
+		if out.ClientCertificateData != "cert" || out.ClientKeyData != "key" {
+			t.Errorf("unexpected output: %+v", out)
+		}
+	})
+
+	t.Run("non-2xx status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}))
+		defer srv.Close()
+
+		c := &concierge.Client{}
+		_, err := c.Exchange(context.Background(), concierge.Input{Endpoint: srv.URL, IDToken: "id-token"})
+		if err == nil {
+			t.Fatal("Exchange() unexpectedly succeeded")
+		}
+		if !strings.Contains(err.Error(), "403") {
+			t.Errorf("error should mention the status code, got: %s", err)
+		}
+	})
+
+	t.Run("rejected with a message", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"status": {"message": "authentication failed"}}`))
+		}))
+		defer srv.Close()
+
+		c := &concierge.Client{}
+		_, err := c.Exchange(context.Background(), concierge.Input{Endpoint: srv.URL, IDToken: "id-token"})
+		if err == nil {
+			t.Fatal("Exchange() unexpectedly succeeded")
+		}
+		if !strings.Contains(err.Error(), "authentication failed") {
+			t.Errorf("error should mention the rejection message, got: %s", err)
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package concierge
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// tokenCredentialRequest mirrors login.concierge.pinniped.dev/v1alpha1.TokenCredentialRequest,
+// trimmed to the fields kubelogin needs to send and read.
+type tokenCredentialRequest struct {
+	metav1.TypeMeta `json:",inline"`
+	Spec            tokenCredentialRequestSpec   `json:"spec"`
+	Status          tokenCredentialRequestStatus `json:"status,omitempty"`
+}
+
+type tokenCredentialRequestSpec struct {
+	Token         string                           `json:"token,omitempty"`
+	Authenticator corev1.TypedLocalObjectReference `json:"authenticator"`
+}
+
+type tokenCredentialRequestStatus struct {
+	Credential *tokenCredentialRequestCredential `json:"credential,omitempty"`
+	Message    string                            `json:"message,omitempty"`
+}
+
+type tokenCredentialRequestCredential struct {
+	ClientCertificateData string      `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string      `json:"clientKeyData,omitempty"`
+	ExpirationTimestamp   metav1.Time `json:"expirationTimestamp"`
+}
@@ -0,0 +1,65 @@
+// Package credentialpluginwriter provides the adaptor for writing an ExecCredential
+// to client-go, per the client-go credential plugin protocol.
+package credentialpluginwriter
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/wire"
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
+)
+
+//go:generate mockgen -destination mock_credentialpluginwriter/mock_credentialpluginwriter.go github.com/int128/kubelogin/pkg/adaptors/credentialpluginwriter Interface
+
+var Set = wire.NewSet(
+	wire.Struct(new(Writer), "*"),
+	wire.Bind(new(Interface), new(*Writer)),
+)
+
+// Output represents the token to write to client-go, as an ExecCredential.
+type Output struct {
+	Token                 string // set for the plain OIDC ID token flow
+	ClientCertificateData string // set when a mTLS client certificate was issued instead of a token
+	ClientKeyData         string
+	Expiry                time.Time
+}
+
+// Interface writes an ExecCredential to client-go.
+type Interface interface {
+	Write(out Output) error
+}
+
+// Writer writes an ExecCredential to the standard output.
+type Writer struct{}
+
+func (*Writer) Write(out Output) error {
+	return write(os.Stdout, out)
+}
+
+func write(w io.Writer, out Output) error {
+	ec := &v1.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "client.authentication.k8s.io/v1beta1",
+			Kind:       "ExecCredential",
+		},
+		Status: &v1.ExecCredentialStatus{
+			ExpirationTimestamp: &metav1.Time{Time: out.Expiry},
+		},
+	}
+	if out.ClientCertificateData != "" || out.ClientKeyData != "" {
+		ec.Status.ClientCertificateData = out.ClientCertificateData
+		ec.Status.ClientKeyData = out.ClientKeyData
+	} else {
+		ec.Status.Token = out.Token
+	}
+	e := json.NewEncoder(w)
+	if err := e.Encode(ec); err != nil {
+		return xerrors.Errorf("could not encode the credential: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Package logger provides the logging facade used by the use-cases and adaptors.
+package logger
+
+//go:generate mockgen -destination mock_logger/mock_logger.go github.com/int128/kubelogin/pkg/adaptors/logger Interface
+
+// Interface provides logging methods.
+// V returns a verbose logger which is enabled only if the level is at or below
+// the verbosity threshold given via the --v flag.
+type Interface interface {
+	Printf(format string, args ...interface{})
+	V(level int) Verbose
+	IsEnabled(level int) bool
+}
+
+// Verbose is a logger for a specific verbosity level.
+type Verbose interface {
+	Infof(format string, args ...interface{})
+}
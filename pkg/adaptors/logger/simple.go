@@ -0,0 +1,35 @@
+package logger
+
+import "log"
+
+// New returns an Interface that writes to the standard logger, showing
+// verbose messages only up to verbosity.
+func New(verbosity int) Interface {
+	return &simple{verbosity: verbosity}
+}
+
+type simple struct {
+	verbosity int
+}
+
+func (l *simple) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+func (l *simple) IsEnabled(level int) bool {
+	return level <= l.verbosity
+}
+
+func (l *simple) V(level int) Verbose {
+	return verbose{enabled: l.IsEnabled(level)}
+}
+
+type verbose struct {
+	enabled bool
+}
+
+func (v verbose) Infof(format string, args ...interface{}) {
+	if v.enabled {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,166 @@
+// Package oidcclient provides the adaptor for talking to an OIDC provider:
+// discovery, the token endpoint (authorization code, ROPC and refresh token
+// grants) and ID token verification.
+package oidcclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"golang.org/x/xerrors"
+
+	"github.com/int128/kubelogin/pkg/adaptors/certpool"
+	"github.com/int128/kubelogin/pkg/oidc"
+)
+
+// FactoryInput configures the client returned by New.
+type FactoryInput struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	ExtraScopes   []string
+	CertPool      certpool.Interface
+	SkipTLSVerify bool
+}
+
+// Interface builds the authorization URL, runs a single grant against the
+// token endpoint, or verifies an existing ID token. Each grant returns a token
+// set on success; Verify returns the claims of the ID token.
+type Interface interface {
+	AuthCodeURL(redirectURI, state, nonce, codeChallenge string, extra map[string]string) string
+	Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (*oidc.TokenSet, error)
+	ROPC(ctx context.Context, username, password string) (*oidc.TokenSet, error)
+	Refresh(ctx context.Context, refreshToken string) (*oidc.TokenSet, error)
+	Verify(ctx context.Context, idToken string) (*oidc.IDTokenClaims, error)
+}
+
+// New discovers the provider at in.IssuerURL and returns a client for it.
+func New(ctx context.Context, in FactoryInput) (Interface, error) {
+	httpClient := &http.Client{}
+	if in.CertPool != nil || in.SkipTLSVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: in.SkipTLSVerify} //nolint:gosec // opt-in via --insecure-skip-tls-verify
+		if in.CertPool != nil {
+			tlsConfig.RootCAs = in.CertPool.Pool()
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	ctx = gooidc.ClientContext(ctx, httpClient)
+
+	provider, err := gooidc.NewProvider(ctx, in.IssuerURL)
+	if err != nil {
+		return nil, xerrors.Errorf("could not discover the OIDC provider at %s: %w", in.IssuerURL, err)
+	}
+	scopes := append([]string{gooidc.ScopeOpenID}, in.ExtraScopes...)
+	return &client{
+		httpClient: httpClient,
+		provider:   provider,
+		verifier:   provider.Verifier(&gooidc.Config{ClientID: in.ClientID}),
+		oauth2Config: oauth2.Config{
+			ClientID:     in.ClientID,
+			ClientSecret: in.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+	}, nil
+}
+
+type client struct {
+	httpClient   *http.Client
+	provider     *gooidc.Provider
+	verifier     *gooidc.IDTokenVerifier
+	oauth2Config oauth2.Config
+}
+
+func (c *client) AuthCodeURL(redirectURI, state, nonce, codeChallenge string, extra map[string]string) string {
+	cfg := c.oauth2Config
+	cfg.RedirectURL = redirectURI
+	opts := []oauth2.AuthCodeOption{
+		gooidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	for k, v := range extra {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+	return cfg.AuthCodeURL(state, opts...)
+}
+
+func (c *client) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (*oidc.TokenSet, error) {
+	ctx = gooidc.ClientContext(ctx, c.httpClient)
+	cfg := c.oauth2Config
+	cfg.RedirectURL = redirectURI
+	token, err := cfg.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, xerrors.Errorf("could not exchange the authorization code: %w", err)
+	}
+	return c.verify(ctx, token)
+}
+
+func (c *client) ROPC(ctx context.Context, username, password string) (*oidc.TokenSet, error) {
+	ctx = gooidc.ClientContext(ctx, c.httpClient)
+	token, err := c.oauth2Config.PasswordCredentialsToken(ctx, username, password)
+	if err != nil {
+		return nil, xerrors.Errorf("could not get a token by the resource owner password credentials grant: %w", err)
+	}
+	return c.verify(ctx, token)
+}
+
+func (c *client) Refresh(ctx context.Context, refreshToken string) (*oidc.TokenSet, error) {
+	ctx = gooidc.ClientContext(ctx, c.httpClient)
+	source := c.oauth2Config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken})
+	token, err := source.Token()
+	if err != nil {
+		return nil, xerrors.Errorf("could not refresh the token: %w", err)
+	}
+	return c.verify(ctx, token)
+}
+
+func (c *client) Verify(ctx context.Context, idToken string) (*oidc.IDTokenClaims, error) {
+	verified, err := c.verifier.Verify(ctx, idToken)
+	if err != nil {
+		return nil, xerrors.Errorf("could not verify the ID token: %w", err)
+	}
+	return claimsOf(verified)
+}
+
+func (c *client) verify(ctx context.Context, token *oauth2.Token) (*oidc.TokenSet, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, xerrors.New("no id_token in the token response")
+	}
+	verified, err := c.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, xerrors.Errorf("could not verify the ID token: %w", err)
+	}
+	claims, err := claimsOf(verified)
+	if err != nil {
+		return nil, err
+	}
+	return &oidc.TokenSet{
+		IDToken:       rawIDToken,
+		RefreshToken:  token.RefreshToken,
+		IDTokenClaims: *claims,
+	}, nil
+}
+
+func claimsOf(verified *gooidc.IDToken) (*oidc.IDTokenClaims, error) {
+	var raw map[string]interface{}
+	if err := verified.Claims(&raw); err != nil {
+		return nil, xerrors.Errorf("could not parse the ID token claims: %w", err)
+	}
+	subject, _ := raw["sub"].(string)
+	pretty, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, xerrors.Errorf("could not format the ID token claims: %w", err)
+	}
+	return &oidc.IDTokenClaims{
+		Subject:  subject,
+		Expiry:   verified.Expiry,
+		IssuedAt: verified.IssuedAt,
+		Pretty:   string(pretty),
+	}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package tokencache
+
+import (
+	"os"
+	"syscall"
+)
+
+func tryFlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func funlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,58 @@
+package tokencache
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// lockPollInterval is how often AcquireLock retries a busy lock while it
+// waits for the timeout.
+const lockPollInterval = 100 * time.Millisecond
+
+// AcquireLock takes an exclusive, advisory lock on the sidecar .lock file for
+// the cache entry identified by key. It blocks until the lock is acquired or
+// timeout elapses, returning an error in the latter case.
+//
+// The returned unlock function releases the lock and must always be called,
+// typically via defer.
+func AcquireLock(dir string, key Key, timeout time.Duration) (unlock func(), err error) {
+	p, err := lockFilename(dir, key)
+	if err != nil {
+		return nil, xerrors.Errorf("could not compute the lock file name: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, xerrors.Errorf("could not create the cache directory: %w", err)
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("could not open the lock file %s: %w", p, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := tryFlock(f)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, xerrors.Errorf("timed out after %s waiting for the lock on %s", timeout, p)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() {
+		_ = funlock(f)
+		_ = f.Close()
+	}, nil
+}
+
+func lockFilename(dir string, key Key) (string, error) {
+	p, err := filename(dir, key)
+	if err != nil {
+		return "", err
+	}
+	return p + ".lock", nil
+}
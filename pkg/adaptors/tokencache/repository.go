@@ -0,0 +1,87 @@
+package tokencache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// Repository provides the file system backed implementation of Interface.
+// Each entry is stored as a YAML file named by the SHA-256 digest of its Key.
+type Repository struct{}
+
+func (r *Repository) FindByKey(dir string, key Key) (*Value, error) {
+	p, err := filename(dir, key)
+	if err != nil {
+		return nil, xerrors.Errorf("could not compute the file name: %w", err)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, xerrors.Errorf("could not read the cache file %s: %w", p, err)
+	}
+	var v Value
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, xerrors.Errorf("could not unmarshal the cache file %s: %w", p, err)
+	}
+	return &v, nil
+}
+
+// Save writes value atomically: it writes to a temporary file in dir and then
+// renames it over the destination, so a concurrent reader never sees a
+// partially written cache file.
+func (r *Repository) Save(dir string, key Key, value Value) error {
+	p, err := filename(dir, key)
+	if err != nil {
+		return xerrors.Errorf("could not compute the file name: %w", err)
+	}
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return xerrors.Errorf("could not marshal the cache: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return xerrors.Errorf("could not create the cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(p)+".tmp-*")
+	if err != nil {
+		return xerrors.Errorf("could not create a temporary cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return xerrors.Errorf("could not write the temporary cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return xerrors.Errorf("could not close the temporary cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return xerrors.Errorf("could not rename the temporary cache file to %s: %w", p, err)
+	}
+	return nil
+}
+
+// filename returns the path of the cache file for the given key,
+// named by the SHA-256 digest of its YAML representation.
+func filename(dir string, key Key) (string, error) {
+	h, err := KeyHash(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, h), nil
+}
+
+// KeyHash returns the SHA-256 digest of key's YAML representation, hex
+// encoded. It is exported so that other components (such as the
+// credentialplugin daemon socket) can derive a name from the same identity
+// a cache entry is keyed by.
+func KeyHash(key Key) (string, error) {
+	b, err := yaml.Marshal(key)
+	if err != nil {
+		return "", xerrors.Errorf("could not marshal the key: %w", err)
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
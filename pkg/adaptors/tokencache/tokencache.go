@@ -0,0 +1,48 @@
+// Package tokencache provides the adaptor for caching a token set to the file
+// system, keyed by the parameters of the OIDC provider.
+package tokencache
+
+import "github.com/google/wire"
+
+//go:generate mockgen -destination mock_tokencache/mock_tokencache.go github.com/int128/kubelogin/pkg/adaptors/tokencache Interface
+
+var Set = wire.NewSet(
+	wire.Struct(new(Repository), "*"),
+	wire.Bind(new(Interface), new(*Repository)),
+)
+
+// Key represents the key of a token cache entry.
+// A cache entry is shared only by the requests with the same key.
+type Key struct {
+	IssuerURL      string
+	ClientID       string
+	ClientSecret   string
+	ExtraScopes    []string
+	CACertFilename string
+	CACertData     string
+	SkipTLSVerify  bool
+
+	// Concierge fields: present when the token is used for a Pinniped
+	// concierge client certificate exchange against a particular cluster.
+	ConciergeEnabled        bool
+	ConciergeEndpoint       string
+	ConciergeAPIGroupSuffix string
+	ConciergeAuthenticator  string // kind/name of the authenticator, e.g. "JWTAuthenticator/my-authenticator"
+
+	// IdentityProviderName and IdentityProviderType select a named upstream
+	// IdP federated behind the issuer.
+	IdentityProviderName string
+	IdentityProviderType string
+}
+
+// Value represents the value of a token cache entry.
+type Value struct {
+	IDToken      string
+	RefreshToken string
+}
+
+// Interface provides the access to the token cache.
+type Interface interface {
+	FindByKey(dir string, key Key) (*Value, error)
+	Save(dir string, key Key, value Value) error
+}
@@ -0,0 +1,19 @@
+// Package oidc provides the models of the OpenID Connect protocol.
+package oidc
+
+import "time"
+
+// TokenSet represents a set of tokens received from the OIDC provider.
+type TokenSet struct {
+	IDToken       string
+	RefreshToken  string
+	IDTokenClaims IDTokenClaims
+}
+
+// IDTokenClaims represents the claims of an ID token.
+type IDTokenClaims struct {
+	Subject  string
+	Expiry   time.Time
+	Pretty   string // human-readable representation for logging
+	IssuedAt time.Time
+}
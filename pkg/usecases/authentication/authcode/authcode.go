@@ -0,0 +1,190 @@
+// Package authcode implements the authorization code flow: it opens the
+// authorization URL in the user's browser and receives the code back on a
+// local HTTP server bound to one of Input.BindAddress.
+package authcode
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+
+	"github.com/google/wire"
+	"golang.org/x/xerrors"
+
+	"github.com/int128/kubelogin/pkg/adaptors/oidcclient"
+	"github.com/int128/kubelogin/pkg/oidc"
+)
+
+//go:generate mockgen -destination mock_authcode/mock_authcode.go github.com/int128/kubelogin/pkg/usecases/authentication/authcode Interface
+
+var Set = wire.NewSet(
+	wire.Struct(new(Flow), "*"),
+	wire.Bind(new(Interface), new(*Flow)),
+)
+
+// Input is the input DTO of the authorization code flow.
+type Input struct {
+	Client          oidcclient.Interface
+	BindAddress     []string
+	SkipOpenBrowser bool
+
+	// IDPHintName and IDPHintParam append a Keycloak/Dex/Auth0-style identity
+	// provider hint to the authorization URL when IDPHintName is non-empty.
+	// IDPHintParam is the query parameter name to use, e.g. "kc_idp_hint" or
+	// "idp"; "acr_values" sends it as the acr_values parameter instead.
+	IDPHintName  string
+	IDPHintParam string
+}
+
+// Interface runs the authorization code flow and returns the obtained token set.
+type Interface interface {
+	Do(ctx context.Context, in Input) (*oidc.TokenSet, error)
+}
+
+// Flow implements Interface.
+type Flow struct{}
+
+func (*Flow) Do(ctx context.Context, in Input) (*oidc.TokenSet, error) {
+	l, addr, err := listen(in.BindAddress)
+	if err != nil {
+		return nil, xerrors.Errorf("could not bind a local server to receive the authorization code: %w", err)
+	}
+	defer l.Close()
+
+	state, err := randomString()
+	if err != nil {
+		return nil, xerrors.Errorf("could not generate a state: %w", err)
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, xerrors.Errorf("could not generate a nonce: %w", err)
+	}
+	codeVerifier, err := randomString()
+	if err != nil {
+		return nil, xerrors.Errorf("could not generate a code verifier: %w", err)
+	}
+	codeChallenge := codeChallengeS256(codeVerifier)
+	redirectURI := fmt.Sprintf("http://%s/", addr)
+
+	extra := hintParams(in.IDPHintName, in.IDPHintParam)
+	authCodeURL := in.Client.AuthCodeURL(redirectURI, state, nonce, codeChallenge, extra)
+
+	if !in.SkipOpenBrowser {
+		if err := openBrowser(authCodeURL); err != nil {
+			fmt.Printf("Please open the following URL in your browser:\n%s\n", authCodeURL)
+		}
+	} else {
+		fmt.Printf("Please open the following URL in your browser:\n%s\n", authCodeURL)
+	}
+
+	code, err := receiveCode(ctx, l, state)
+	if err != nil {
+		return nil, xerrors.Errorf("could not receive the authorization code: %w", err)
+	}
+	tokenSet, err := in.Client.Exchange(ctx, code, codeVerifier, redirectURI)
+	if err != nil {
+		return nil, xerrors.Errorf("could not exchange the authorization code for a token: %w", err)
+	}
+	return tokenSet, nil
+}
+
+// DefaultIDPHintParam is the query parameter hintParams uses when
+// Input.IDPHintParam is empty.
+const DefaultIDPHintParam = "acr_values"
+
+// hintParams returns the query parameters that carry an identity provider
+// hint on the authorization URL, per the configured param name. An empty
+// name disables the hint.
+func hintParams(name, param string) map[string]string {
+	if name == "" {
+		return nil
+	}
+	if param == "" {
+		param = DefaultIDPHintParam
+	}
+	return map[string]string{param: name}
+}
+
+// listen binds the first available address out of candidates, or ":0" on the
+// loopback interface if none is given.
+func listen(candidates []string) (net.Listener, string, error) {
+	if len(candidates) == 0 {
+		candidates = []string{"127.0.0.1:0"}
+	}
+	var lastErr error
+	for _, addr := range candidates {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return l, l.Addr().String(), nil
+	}
+	return nil, "", xerrors.Errorf("could not bind to any of %v: %w", candidates, lastErr)
+}
+
+// receiveCode serves a single request on l, validates the returned state and
+// extracts the authorization code.
+func receiveCode(ctx context.Context, l net.Listener, state string) (string, error) {
+	codeCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if got := q.Get("state"); got != state {
+			errCh <- xerrors.Errorf("state does not match, got %s", got)
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			return
+		}
+		if errParam := q.Get("error"); errParam != "" {
+			errCh <- xerrors.Errorf("authorization error: %s %s", errParam, q.Get("error_description"))
+			http.Error(w, "authorization error", http.StatusBadRequest)
+			return
+		}
+		codeCh <- q.Get("code")
+		fmt.Fprintln(w, "You have logged in. You can close this tab.")
+	})}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case err := <-errCh:
+		return "", err
+	case code := <-codeCh:
+		return code, nil
+	}
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", xerrors.Errorf("could not read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func codeChallengeS256(codeVerifier string) string {
+	h := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// openBrowser opens url in the default browser of the current platform.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,158 @@
+// Package authentication provides the use-case for running the authentication flows
+// (authorization code, resource owner password credentials, and refresh token)
+// against an OIDC provider.
+package authentication
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/wire"
+	"golang.org/x/xerrors"
+
+	"github.com/int128/kubelogin/pkg/adaptors/certpool"
+	"github.com/int128/kubelogin/pkg/adaptors/logger"
+	"github.com/int128/kubelogin/pkg/adaptors/oidcclient"
+	"github.com/int128/kubelogin/pkg/oidc"
+	"github.com/int128/kubelogin/pkg/usecases/authentication/authcode"
+	"github.com/int128/kubelogin/pkg/usecases/authentication/ropc"
+)
+
+//go:generate mockgen -destination mock_authentication/mock_authentication.go github.com/int128/kubelogin/pkg/usecases/authentication Interface
+
+var Set = wire.NewSet(
+	wire.Struct(new(Authentication), "*"),
+	wire.Bind(new(Interface), new(*Authentication)),
+)
+
+// GrantOptionSet represents the options for the grant flows.
+// Exactly one of the fields should be set.
+type GrantOptionSet struct {
+	AuthCodeOption         *AuthCodeOption
+	AuthCodeKeyboardOption *AuthCodeKeyboardOption
+	ROPCOption             *ROPCOption
+}
+
+// AuthCodeOption represents the options for the authorization code flow.
+type AuthCodeOption struct {
+	BindAddress      []string
+	SkipOpenBrowser  bool
+	AuthCodeDuration int
+}
+
+// AuthCodeKeyboardOption represents the options for the authorization code flow
+// with the out-of-band input of the code, for the headless environment.
+type AuthCodeKeyboardOption struct{}
+
+// ROPCOption represents the options for the resource owner password credentials flow.
+type ROPCOption struct {
+	Username string
+	Password string
+}
+
+// Input represents an input DTO of the Authentication use-case.
+type Input struct {
+	IssuerURL      string
+	ClientID       string
+	ClientSecret   string
+	ExtraScopes    []string
+	CertPool       certpool.Interface
+	SkipTLSVerify  bool
+	IDToken        string // optional, the cached ID token
+	RefreshToken   string // optional, the cached refresh token
+	GrantOptionSet GrantOptionSet
+
+	// IdentityProviderName selects a named upstream identity provider at the
+	// issuer, e.g. for a Keycloak or Dex broker that federates several IdPs
+	// behind one issuer URL. It is ignored if empty.
+	IdentityProviderName string
+	// IdentityProviderType is the name of the query parameter used to carry
+	// IdentityProviderName on the authorization URL, e.g. "kc_idp_hint" for
+	// Keycloak or "idp" for Dex. If it is "acr_values", IdentityProviderName
+	// is sent as the acr_values parameter instead of a vendor-specific hint.
+	IdentityProviderType string
+}
+
+// Output represents an output DTO of the Authentication use-case.
+type Output struct {
+	TokenSet               oidc.TokenSet
+	AlreadyHasValidIDToken bool
+}
+
+// Interface runs the authentication flow and returns a valid token set.
+type Interface interface {
+	Do(ctx context.Context, in Input) (*Output, error)
+}
+
+// Authentication implements Interface. It verifies a cached ID token if
+// present, otherwise tries a refresh token, and falls back to running the
+// grant flow selected by Input.GrantOptionSet.
+type Authentication struct {
+	AuthCodeFlow authcode.Interface
+	ROPCFlow     ropc.Interface
+	Logger       logger.Interface
+}
+
+func (u *Authentication) Do(ctx context.Context, in Input) (*Output, error) {
+	client, err := oidcclient.New(ctx, oidcclient.FactoryInput{
+		IssuerURL:     in.IssuerURL,
+		ClientID:      in.ClientID,
+		ClientSecret:  in.ClientSecret,
+		ExtraScopes:   in.ExtraScopes,
+		CertPool:      in.CertPool,
+		SkipTLSVerify: in.SkipTLSVerify,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("could not set up the OIDC client: %w", err)
+	}
+
+	if in.IDToken != "" {
+		if claims, err := client.Verify(ctx, in.IDToken); err == nil && claims.Expiry.After(time.Now()) {
+			return &Output{
+				TokenSet: oidc.TokenSet{
+					IDToken:       in.IDToken,
+					RefreshToken:  in.RefreshToken,
+					IDTokenClaims: *claims,
+				},
+				AlreadyHasValidIDToken: true,
+			}, nil
+		}
+	}
+
+	if in.RefreshToken != "" {
+		tokenSet, err := client.Refresh(ctx, in.RefreshToken)
+		if err == nil {
+			return &Output{TokenSet: *tokenSet}, nil
+		}
+		u.Logger.V(1).Infof("could not refresh the token, falling back to the grant flow: %s", err)
+	}
+
+	tokenSet, err := u.doGrantFlow(ctx, client, in.GrantOptionSet, in.IdentityProviderName, in.IdentityProviderType)
+	if err != nil {
+		return nil, xerrors.Errorf("could not get a token by the grant flow: %w", err)
+	}
+	return &Output{TokenSet: *tokenSet}, nil
+}
+
+func (u *Authentication) doGrantFlow(ctx context.Context, client oidcclient.Interface, opts GrantOptionSet, idpHintName, idpHintParam string) (*oidc.TokenSet, error) {
+	switch {
+	case opts.AuthCodeOption != nil:
+		return u.AuthCodeFlow.Do(ctx, authcode.Input{
+			Client:          client,
+			BindAddress:     opts.AuthCodeOption.BindAddress,
+			SkipOpenBrowser: opts.AuthCodeOption.SkipOpenBrowser,
+			IDPHintName:     idpHintName,
+			IDPHintParam:    idpHintParam,
+		})
+	case opts.ROPCOption != nil:
+		return u.ROPCFlow.Do(ctx, ropc.Input{
+			Client:   client,
+			Username: opts.ROPCOption.Username,
+			Password: opts.ROPCOption.Password,
+		})
+	case opts.AuthCodeKeyboardOption != nil:
+		return nil, xerrors.New("the keyboard input flow is not supported yet")
+	default:
+		return nil, xerrors.New("no grant flow is set")
+	}
+}
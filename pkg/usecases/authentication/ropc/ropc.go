@@ -0,0 +1,40 @@
+// Package ropc implements the resource owner password credentials flow.
+package ropc
+
+import (
+	"context"
+
+	"github.com/google/wire"
+	"golang.org/x/xerrors"
+
+	"github.com/int128/kubelogin/pkg/adaptors/oidcclient"
+	"github.com/int128/kubelogin/pkg/oidc"
+)
+
+var Set = wire.NewSet(
+	wire.Struct(new(Flow), "*"),
+	wire.Bind(new(Interface), new(*Flow)),
+)
+
+// Input is the input DTO of the ROPC flow.
+type Input struct {
+	Client   oidcclient.Interface
+	Username string
+	Password string
+}
+
+// Interface runs the ROPC flow and returns the obtained token set.
+type Interface interface {
+	Do(ctx context.Context, in Input) (*oidc.TokenSet, error)
+}
+
+// Flow implements Interface.
+type Flow struct{}
+
+func (*Flow) Do(ctx context.Context, in Input) (*oidc.TokenSet, error) {
+	tokenSet, err := in.Client.ROPC(ctx, in.Username, in.Password)
+	if err != nil {
+		return nil, xerrors.Errorf("resource owner password credentials grant error: %w", err)
+	}
+	return tokenSet, nil
+}
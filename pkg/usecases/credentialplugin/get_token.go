@@ -5,13 +5,18 @@ package credentialplugin
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/wire"
+	corev1 "k8s.io/api/core/v1"
+
 	"github.com/int128/kubelogin/pkg/adaptors/certpool"
+	"github.com/int128/kubelogin/pkg/adaptors/concierge"
 	"github.com/int128/kubelogin/pkg/adaptors/credentialpluginwriter"
 	"github.com/int128/kubelogin/pkg/adaptors/logger"
 	"github.com/int128/kubelogin/pkg/adaptors/tokencache"
 	"github.com/int128/kubelogin/pkg/usecases/authentication"
+	"github.com/int128/kubelogin/pkg/usecases/authentication/authcode"
 	"golang.org/x/xerrors"
 )
 
@@ -26,6 +31,9 @@ type Interface interface {
 	Do(ctx context.Context, in Input) error
 }
 
+// defaultLockTimeout is used when Input.LockTimeout is zero.
+const defaultLockTimeout = 30 * time.Second
+
 // Input represents an input DTO of the GetToken use-case.
 type Input struct {
 	IssuerURL      string
@@ -37,32 +45,85 @@ type Input struct {
 	SkipTLSVerify  bool
 	TokenCacheDir  string
 	GrantOptionSet authentication.GrantOptionSet
+
+	// IdentityProviderName selects a named upstream identity provider at the
+	// issuer, passed to the --oidc-idp-hint flag. IdentityProviderType is the
+	// name of the query parameter used to carry it on the authorization URL,
+	// e.g. "kc_idp_hint" for Keycloak or "idp" for Dex, passed to
+	// --oidc-idp-hint-param; "acr_values" sends it as the acr_values parameter
+	// instead. Both are ignored if IdentityProviderName is empty.
+	IdentityProviderName string
+	IdentityProviderType string
+
+	// LockTimeout bounds how long GetToken waits to acquire the token cache
+	// lock before giving up. It defaults to 30 seconds when zero.
+	LockTimeout time.Duration
+
+	// ConciergeEnabled, when true, exchanges the ID token for a Pinniped concierge
+	// client certificate instead of handing the ID token to client-go directly.
+	ConciergeEnabled        bool
+	ConciergeEndpoint       string
+	ConciergeCABundle       []byte
+	ConciergeAPIGroupSuffix string
+	ConciergeAuthenticator  corev1.TypedLocalObjectReference
 }
 
 type GetToken struct {
 	Authentication       authentication.Interface
 	TokenCacheRepository tokencache.Interface
 	NewCertPool          certpool.NewFunc
+	Concierge            concierge.Interface
 	Writer               credentialpluginwriter.Interface
 	Logger               logger.Interface
 }
 
 func (u *GetToken) Do(ctx context.Context, in Input) error {
 	u.Logger.V(1).Infof("WARNING: log may contain your secrets such as token or password")
-	out, err := u.getTokenFromCacheOrProvider(ctx, in)
+	out, found, err := u.tryDaemon(in)
 	if err != nil {
-		return xerrors.Errorf("could not get a token: %w", err)
+		return xerrors.Errorf("could not get a token from the daemon: %w", err)
 	}
-	u.Logger.V(1).Infof("writing the token to client-go")
-	if err := u.Writer.Write(credentialpluginwriter.Output{Token: out.TokenSet.IDToken, Expiry: out.TokenSet.IDTokenClaims.Expiry}); err != nil {
-		return xerrors.Errorf("could not write the token to client-go: %w", err)
+	if !found {
+		out, err = u.getTokenFromCacheOrProvider(ctx, in)
+		if err != nil {
+			return xerrors.Errorf("could not get a token: %w", err)
+		}
+	}
+	if !in.ConciergeEnabled {
+		u.Logger.V(1).Infof("writing the token to client-go")
+		if err := u.Writer.Write(credentialpluginwriter.Output{Token: out.TokenSet.IDToken, Expiry: out.TokenSet.IDTokenClaims.Expiry}); err != nil {
+			return xerrors.Errorf("could not write the token to client-go: %w", err)
+		}
+		return nil
+	}
+
+	u.Logger.V(1).Infof("exchanging the ID token for a concierge client certificate")
+	cred, err := u.Concierge.Exchange(ctx, concierge.Input{
+		Endpoint:       in.ConciergeEndpoint,
+		CABundle:       in.ConciergeCABundle,
+		APIGroupSuffix: in.ConciergeAPIGroupSuffix,
+		Authenticator:  in.ConciergeAuthenticator,
+		IDToken:        out.TokenSet.IDToken,
+	})
+	if err != nil {
+		return xerrors.Errorf("could not exchange the ID token for a client certificate: %w", err)
+	}
+	u.Logger.V(1).Infof("writing the client certificate to client-go")
+	if err := u.Writer.Write(credentialpluginwriter.Output{
+		ClientCertificateData: cred.ClientCertificateData,
+		ClientKeyData:         cred.ClientKeyData,
+		Expiry:                cred.ExpirationTimestamp.Time,
+	}); err != nil {
+		return xerrors.Errorf("could not write the client certificate to client-go: %w", err)
 	}
 	return nil
 }
 
-func (u *GetToken) getTokenFromCacheOrProvider(ctx context.Context, in Input) (*authentication.Output, error) {
-	u.Logger.V(1).Infof("finding a token from cache directory %s", in.TokenCacheDir)
-	tokenCacheKey := tokencache.Key{
+// cacheKeyFor builds the tokencache.Key that identifies in's cache entry.
+// Two Inputs that would authenticate against the same token must build the
+// same Key, and two that wouldn't must not.
+func cacheKeyFor(in Input) tokencache.Key {
+	return tokencache.Key{
 		IssuerURL:      in.IssuerURL,
 		ClientID:       in.ClientID,
 		ClientSecret:   in.ClientSecret,
@@ -70,7 +131,56 @@ func (u *GetToken) getTokenFromCacheOrProvider(ctx context.Context, in Input) (*
 		CACertFilename: in.CACertFilename,
 		CACertData:     in.CACertData,
 		SkipTLSVerify:  in.SkipTLSVerify,
+
+		ConciergeEnabled:        in.ConciergeEnabled,
+		ConciergeEndpoint:       in.ConciergeEndpoint,
+		ConciergeAPIGroupSuffix: in.ConciergeAPIGroupSuffix,
+		ConciergeAuthenticator:  authenticatorKey(in.ConciergeAuthenticator),
+
+		IdentityProviderName: in.IdentityProviderName,
+		IdentityProviderType: identityProviderTypeKey(in),
 	}
+}
+
+// identityProviderTypeKey normalizes IdentityProviderType the same way
+// authcode.hintParams does before it reaches the authorization URL, so the
+// default param (omitted) and its explicit spelling hash to the same key.
+func identityProviderTypeKey(in Input) string {
+	if in.IdentityProviderName == "" {
+		return ""
+	}
+	if in.IdentityProviderType == "" {
+		return authcode.DefaultIDPHintParam
+	}
+	return in.IdentityProviderType
+}
+
+// authenticatorKey renders ref as the string stored in a cache key, so an
+// unset authenticator (the common non-concierge case) hashes the same as a
+// zero-value tokencache.Key rather than producing a spurious "/".
+func authenticatorKey(ref corev1.TypedLocalObjectReference) string {
+	if ref.Kind == "" && ref.Name == "" {
+		return ""
+	}
+	return ref.Kind + "/" + ref.Name
+}
+
+func (u *GetToken) getTokenFromCacheOrProvider(ctx context.Context, in Input) (*authentication.Output, error) {
+	u.Logger.V(1).Infof("finding a token from cache directory %s", in.TokenCacheDir)
+	tokenCacheKey := cacheKeyFor(in)
+
+	lockTimeout := in.LockTimeout
+	if lockTimeout == 0 {
+		lockTimeout = defaultLockTimeout
+	}
+	unlock, err := tokencache.AcquireLock(in.TokenCacheDir, tokenCacheKey, lockTimeout)
+	if err != nil {
+		return nil, xerrors.Errorf("could not acquire the token cache lock: %w", err)
+	}
+	defer unlock()
+
+	// Re-read the cache now that we hold the lock: another process may have
+	// refreshed it while we were waiting.
 	tokenCacheValue, err := u.TokenCacheRepository.FindByKey(in.TokenCacheDir, tokenCacheKey)
 	if err != nil {
 		u.Logger.V(1).Infof("could not find a token cache: %s", err)
@@ -97,6 +207,9 @@ func (u *GetToken) getTokenFromCacheOrProvider(ctx context.Context, in Input) (*
 		IDToken:        tokenCacheValue.IDToken,
 		RefreshToken:   tokenCacheValue.RefreshToken,
 		GrantOptionSet: in.GrantOptionSet,
+
+		IdentityProviderName: in.IdentityProviderName,
+		IdentityProviderType: in.IdentityProviderType,
 	})
 	if err != nil {
 		return nil, xerrors.Errorf("authentication error: %w", err)
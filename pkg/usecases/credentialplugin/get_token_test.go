@@ -0,0 +1,153 @@
+package credentialplugin_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/int128/kubelogin/pkg/adaptors/certpool"
+	"github.com/int128/kubelogin/pkg/adaptors/credentialpluginwriter"
+	"github.com/int128/kubelogin/pkg/adaptors/logger"
+	"github.com/int128/kubelogin/pkg/adaptors/tokencache"
+	"github.com/int128/kubelogin/pkg/oidc"
+	"github.com/int128/kubelogin/pkg/usecases/authentication"
+	"github.com/int128/kubelogin/pkg/usecases/credentialplugin"
+)
+
+// fakeIdP models an IdP that invalidates a refresh token as soon as it has
+// been used once, the way a real OIDC provider does. A request bearing a
+// refresh token it has already consumed is rejected.
+type fakeIdP struct {
+	mu                sync.Mutex
+	refreshCalls      int
+	currentIDToken    string
+	currentExpiry     time.Time
+	currentRefreshTok string
+}
+
+func (f *fakeIdP) Do(_ context.Context, in authentication.Input) (*authentication.Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if in.IDToken != "" && in.IDToken == f.currentIDToken && f.currentExpiry.After(time.Now()) {
+		return &authentication.Output{
+			TokenSet: oidc.TokenSet{
+				IDToken:       f.currentIDToken,
+				RefreshToken:  f.currentRefreshTok,
+				IDTokenClaims: oidc.IDTokenClaims{Expiry: f.currentExpiry},
+			},
+			AlreadyHasValidIDToken: true,
+		}, nil
+	}
+	if in.RefreshToken != f.currentRefreshTok {
+		return nil, fmt.Errorf("refresh token %q has already been invalidated", in.RefreshToken)
+	}
+
+	f.refreshCalls++
+	f.currentIDToken = fmt.Sprintf("id-token-%d", f.refreshCalls)
+	f.currentRefreshTok = fmt.Sprintf("refresh-token-%d", f.refreshCalls)
+	f.currentExpiry = time.Now().Add(time.Hour)
+	return &authentication.Output{
+		TokenSet: oidc.TokenSet{
+			IDToken:       f.currentIDToken,
+			RefreshToken:  f.currentRefreshTok,
+			IDTokenClaims: oidc.IDTokenClaims{Expiry: f.currentExpiry},
+		},
+	}, nil
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...interface{}) {}
+func (noopLogger) IsEnabled(int) bool            { return false }
+func (noopLogger) V(int) logger.Verbose          { return noopLogger{} }
+func (noopLogger) Infof(string, ...interface{})  {}
+
+type recordingWriter struct {
+	mu     sync.Mutex
+	tokens []string
+}
+
+func (w *recordingWriter) Write(out credentialpluginwriter.Output) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tokens = append(w.tokens, out.Token)
+	return nil
+}
+
+// TestGetToken_Do_ParallelRefresh spawns many concurrent GetToken.Do calls
+// against a cache entry whose cached ID token has already expired. It
+// verifies that the flock in getTokenFromCacheOrProvider serializes the
+// refresh so that exactly one of them talks to the IdP, and that every
+// caller ends up with that same new ID token.
+func TestGetToken_Do_ParallelRefresh(t *testing.T) {
+	dir := t.TempDir()
+	idp := &fakeIdP{
+		currentIDToken:    "id-token-0",
+		currentRefreshTok: "refresh-token-0",
+		currentExpiry:     time.Now().Add(-time.Minute), // already expired
+	}
+
+	in := credentialplugin.Input{
+		IssuerURL:     "https://issuer.example.com",
+		ClientID:      "client-id",
+		TokenCacheDir: dir,
+		LockTimeout:   10 * time.Second,
+	}
+	cacheKey := tokencache.Key{IssuerURL: in.IssuerURL, ClientID: in.ClientID}
+	repo := &tokencache.Repository{}
+	if err := repo.Save(dir, cacheKey, tokencache.Value{
+		IDToken:      idp.currentIDToken,
+		RefreshToken: idp.currentRefreshTok,
+	}); err != nil {
+		t.Fatalf("could not seed the token cache: %s", err)
+	}
+
+	const parallelism = 20
+	writer := &recordingWriter{}
+	u := &credentialplugin.GetToken{
+		Authentication:       idp,
+		TokenCacheRepository: repo,
+		NewCertPool:          certpool.New,
+		Writer:               writer,
+		Logger:               noopLogger{},
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, parallelism)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := u.Do(context.Background(), in); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Errorf("Do() returned an error: %s", err)
+	}
+
+	idp.mu.Lock()
+	refreshCalls := idp.refreshCalls
+	idp.mu.Unlock()
+	if refreshCalls != 1 {
+		t.Errorf("expected exactly 1 refresh against the IdP, got %d", refreshCalls)
+	}
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if len(writer.tokens) != parallelism {
+		t.Fatalf("expected %d writes, got %d", parallelism, len(writer.tokens))
+	}
+	want := writer.tokens[0]
+	for _, got := range writer.tokens {
+		if got != want {
+			t.Errorf("callers disagreed on the token: got %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package credentialplugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/int128/kubelogin/pkg/adaptors/tokencache"
+	"github.com/int128/kubelogin/pkg/oidc"
+	"github.com/int128/kubelogin/pkg/usecases/authentication"
+)
+
+// leeway is how long before the cached ID token expires that the daemon
+// proactively starts a refresh.
+const leeway = 30 * time.Second
+
+// refreshMinBackoff and refreshMaxBackoff bound the delay refreshLoop waits
+// after a failed refresh, so a sustained IdP outage degrades to occasional
+// retries instead of a busy loop against an already-expired token.
+const (
+	refreshMinBackoff = 1 * time.Second
+	refreshMaxBackoff = 1 * time.Minute
+)
+
+// daemonResponse is what Serve writes back to each client connection.
+type daemonResponse struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// socketNameHashLen is how many hex characters of the token cache key's hash
+// name the socket file. A full 64-char SHA-256 digest plus the "kubelogin-"
+// prefix and ".sock" suffix would push sun_path close to (or past) the
+// ~108-byte limit most platforms impose on Unix domain socket paths; this
+// many characters is still collision-resistant enough for grouping by key.
+const socketNameHashLen = 16
+
+// socketPathForInput returns the path of the Unix domain socket that a daemon
+// serving this Input's token cache entry would listen on, or an error if
+// XDG_RUNTIME_DIR is not set. It is keyed by the same tokencache.Key as the
+// cache entry itself, so that two Inputs only share a daemon if they would
+// also share a cache entry.
+func socketPathForInput(in Input) (string, error) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return "", xerrors.New("XDG_RUNTIME_DIR is not set")
+	}
+	h, err := tokencache.KeyHash(cacheKeyFor(in))
+	if err != nil {
+		return "", xerrors.Errorf("could not hash the token cache key: %w", err)
+	}
+	return filepath.Join(runtimeDir, "kubelogin-"+h[:socketNameHashLen]+".sock"), nil
+}
+
+// tryDaemon connects to a running daemon for in, if any, and returns the token
+// it serves. The second return value is false if no daemon is listening, in
+// which case the caller should fall back to running the full flow itself.
+func (u *GetToken) tryDaemon(in Input) (*authentication.Output, bool, error) {
+	socketPath, err := socketPathForInput(in)
+	if err != nil {
+		return nil, false, nil
+	}
+	conn, err := net.DialTimeout("unix", socketPath, 3*time.Second)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer conn.Close()
+
+	var resp daemonResponse
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+		return nil, true, xerrors.Errorf("could not read the response from the daemon: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, true, xerrors.Errorf("daemon returned an error: %s", resp.Error)
+	}
+	return &authentication.Output{
+		TokenSet: oidc.TokenSet{
+			IDToken:       resp.Token,
+			IDTokenClaims: oidc.IDTokenClaims{Expiry: resp.Expiry},
+		},
+	}, true, nil
+}
+
+// Serve runs as a long-lived daemon: it keeps the token cache entry for in
+// refreshed ahead of expiry and answers each client connection on socketPath
+// with the current token, so that many concurrent kubectl invocations share a
+// single refresh instead of racing the IdP.
+func (u *GetToken) Serve(ctx context.Context, in Input, socketPath string) error {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return xerrors.Errorf("could not create the socket directory: %w", err)
+	}
+	_ = os.Remove(socketPath)
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return xerrors.Errorf("could not listen on %s: %w", socketPath, err)
+	}
+	defer l.Close()
+
+	d := newDaemon()
+	out, err := u.getTokenFromCacheOrProvider(ctx, in)
+	if err != nil {
+		return xerrors.Errorf("could not get the initial token: %w", err)
+	}
+	d.set(out, nil)
+	go d.refreshLoop(ctx, u, in)
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return xerrors.Errorf("could not accept a connection: %w", err)
+		}
+		go d.serveConn(conn)
+	}
+}
+
+// daemon holds the most recently refreshed token. A connection blocks only
+// until the first token is set; after that it is answered at once with the
+// current token, even if that token has already expired.
+type daemon struct {
+	mu  sync.Mutex
+	cv  *sync.Cond
+	out *authentication.Output
+	err error
+}
+
+// newDaemon returns a daemon ready to have set and serveConn called on it.
+func newDaemon() *daemon {
+	d := &daemon{}
+	d.cv = sync.NewCond(&d.mu)
+	return d
+}
+
+func (d *daemon) set(out *authentication.Output, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cv == nil {
+		d.cv = sync.NewCond(&d.mu)
+	}
+	d.out, d.err = out, err
+	d.cv.Broadcast()
+}
+
+func (d *daemon) serveConn(conn net.Conn) {
+	defer conn.Close()
+	d.mu.Lock()
+	for d.out == nil && d.err == nil {
+		d.cv.Wait()
+	}
+	out, err := d.out, d.err
+	d.mu.Unlock()
+
+	resp := daemonResponse{}
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Token = out.TokenSet.IDToken
+		resp.Expiry = out.TokenSet.IDTokenClaims.Expiry
+	}
+	_ = json.NewEncoder(conn).Encode(&resp)
+}
+
+// refreshLoop sleeps until shortly before the cached token expires, then
+// refreshes it and notifies any blocked clients. It runs until ctx is done.
+func (d *daemon) refreshLoop(ctx context.Context, u *GetToken, in Input) {
+	backoff := refreshMinBackoff
+	for {
+		d.mu.Lock()
+		out := d.out
+		d.mu.Unlock()
+		if out == nil {
+			return
+		}
+
+		wait := time.Until(out.TokenSet.IDTokenClaims.Expiry) - leeway
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		newOut, err := u.getTokenFromCacheOrProvider(ctx, in)
+		if err != nil {
+			u.Logger.V(1).Infof("could not refresh the token, retrying in %s: %s", backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > refreshMaxBackoff {
+				backoff = refreshMaxBackoff
+			}
+			continue
+		}
+		backoff = refreshMinBackoff
+		d.set(newOut, nil)
+	}
+}
@@ -0,0 +1,112 @@
+package credentialplugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/int128/kubelogin/pkg/adaptors/certpool"
+	"github.com/int128/kubelogin/pkg/adaptors/logger"
+	"github.com/int128/kubelogin/pkg/adaptors/tokencache"
+	"github.com/int128/kubelogin/pkg/oidc"
+	"github.com/int128/kubelogin/pkg/usecases/authentication"
+)
+
+type quietLogger struct{}
+
+func (quietLogger) Printf(string, ...interface{}) {}
+func (quietLogger) IsEnabled(int) bool            { return false }
+func (quietLogger) V(int) logger.Verbose          { return quietLogger{} }
+func (quietLogger) Infof(string, ...interface{})  {}
+
+// TestDaemon_serveConn_WaitsForSet verifies a connection served before the
+// first token is available blocks until daemon.set is called, rather than
+// observing a torn or zero-value response.
+func TestDaemon_serveConn_WaitsForSet(t *testing.T) {
+	d := newDaemon()
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		d.serveConn(server)
+		close(done)
+	}()
+
+	expiry := time.Now().Add(time.Hour)
+	select {
+	case <-done:
+		t.Fatal("serveConn returned before daemon.set was called")
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.set(&authentication.Output{TokenSet: oidc.TokenSet{
+		IDToken:       "the-token",
+		IDTokenClaims: oidc.IDTokenClaims{Expiry: expiry},
+	}}, nil)
+
+	var resp daemonResponse
+	if err := json.NewDecoder(bufio.NewReader(client)).Decode(&resp); err != nil {
+		t.Fatalf("could not decode the response: %s", err)
+	}
+	if resp.Token != "the-token" {
+		t.Errorf("got token %q, want %q", resp.Token, "the-token")
+	}
+	<-done
+}
+
+// fakeFailingAuthentication always fails, simulating a sustained IdP outage.
+type fakeFailingAuthentication struct {
+	calls int32
+}
+
+func (f *fakeFailingAuthentication) Do(context.Context, authentication.Input) (*authentication.Output, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return nil, xerrors.New("idp is down")
+}
+
+// stubRepository never finds a cached value and discards every Save.
+type stubRepository struct{}
+
+func (*stubRepository) FindByKey(string, tokencache.Key) (*tokencache.Value, error) {
+	return nil, xerrors.New("not found")
+}
+
+func (*stubRepository) Save(string, tokencache.Key, tokencache.Value) error {
+	return nil
+}
+
+// TestDaemon_refreshLoop_BacksOffOnFailure verifies that a sustained refresh
+// failure is retried with backoff, not busy-looped against the expired token.
+func TestDaemon_refreshLoop_BacksOffOnFailure(t *testing.T) {
+	auth := &fakeFailingAuthentication{}
+	u := &GetToken{
+		Authentication:       auth,
+		TokenCacheRepository: &stubRepository{},
+		NewCertPool:          certpool.New,
+		Logger:               quietLogger{},
+	}
+
+	d := newDaemon()
+	d.set(&authentication.Output{TokenSet: oidc.TokenSet{
+		IDToken:       "stale-token",
+		IDTokenClaims: oidc.IDTokenClaims{Expiry: time.Now().Add(-time.Minute)}, // already expired
+	}}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	d.refreshLoop(ctx, u, Input{TokenCacheDir: t.TempDir(), LockTimeout: time.Second})
+
+	calls := atomic.LoadInt32(&auth.calls)
+	if calls < 1 {
+		t.Errorf("expected at least 1 refresh attempt, got %d", calls)
+	}
+	if calls > 3 {
+		t.Errorf("expected backoff to bound retries to a handful, got %d calls in 2.5s", calls)
+	}
+}